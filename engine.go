@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SubprocessEngine manages the lifecycle of all pipelines started through the
+// HTTP API: it hands out ids, keeps the registry of running/finished
+// pipelines and exposes the static info/capabilities reported to clients.
+type SubprocessEngine struct {
+	pipelinesLock sync.Mutex
+	pipelines     map[int]*RunningPipeline
+	nextId        int
+
+	capabilities  EngineCapabilities
+	authenticator Authenticator
+}
+
+type EngineCapabilities struct {
+	MaxLogsUpload int `json:"max_logs_upload"`
+}
+
+// maxLogsUpload caps the number of captured output bytes per pipeline, to
+// avoid a runaway subprocess exhausting memory.
+const maxLogsUpload = 10 * 1024 * 1024
+
+func NewSubprocessEngine() *SubprocessEngine {
+	return &SubprocessEngine{
+		pipelines: make(map[int]*RunningPipeline),
+		capabilities: EngineCapabilities{
+			MaxLogsUpload: maxLogsUpload,
+		},
+	}
+}
+
+func (engine *SubprocessEngine) getInfo() interface{} {
+	return struct {
+		NumPipelines int `json:"num_pipelines"`
+	}{
+		NumPipelines: engine.numPipelines(),
+	}
+}
+
+func (engine *SubprocessEngine) numPipelines() int {
+	engine.pipelinesLock.Lock()
+	defer engine.pipelinesLock.Unlock()
+	return len(engine.pipelines)
+}
+
+// filteredPipelineIds returns the sorted ids of every pipeline accepted by
+// accept. Shared by the HTTP listing routes and their gRPC equivalents so
+// both transports apply identical filtering logic.
+func (engine *SubprocessEngine) filteredPipelineIds(accept func(*RunningPipeline) bool) []int32 {
+	engine.pipelinesLock.Lock()
+	ids := make([]int32, 0, len(engine.pipelines))
+	for _, pipe := range engine.pipelines {
+		if accept(pipe) {
+			ids = append(ids, int32(pipe.Id))
+		}
+	}
+	engine.pipelinesLock.Unlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (engine *SubprocessEngine) getPipelineById(id int) (*RunningPipeline, bool) {
+	engine.pipelinesLock.Lock()
+	defer engine.pipelinesLock.Unlock()
+	pipe, exists := engine.pipelines[id]
+	return pipe, exists
+}
+
+// NewPipeline registers script as a new pipeline and arms its delayed
+// subprocess launch. It never fails synchronously: the subprocess only
+// actually starts later, on its own goroutine, so any launch failure (e.g.
+// the bitflow-pipeline binary is missing) only becomes observable once the
+// pipeline's status moves to StatusFailed. Callers should report the
+// allocated id back to the client and let them poll or stream status from
+// there, rather than expecting a start error up front.
+func (engine *SubprocessEngine) NewPipeline(script string, delay time.Duration, extraParams []string, timeout time.Duration, owner string, labels map[string]string) *RunningPipeline {
+	engine.pipelinesLock.Lock()
+	engine.nextId++
+	id := engine.nextId
+	pipe := &RunningPipeline{
+		Id:     id,
+		Script: script,
+		Owner:  owner,
+		Labels: labels,
+		engine: engine,
+	}
+	pipe.status = StatusStarting
+	engine.pipelines[id] = pipe
+	engine.pipelinesLock.Unlock()
+
+	pipe.start(delay, extraParams, timeout)
+	return pipe
+}
+
+func (engine *SubprocessEngine) removePipeline(id int) {
+	engine.pipelinesLock.Lock()
+	delete(engine.pipelines, id)
+	engine.pipelinesLock.Unlock()
+}
+
+func (engine *SubprocessEngine) String() string {
+	return fmt.Sprintf("SubprocessEngine(%v pipelines)", len(engine.pipelines))
+}
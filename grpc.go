@@ -0,0 +1,193 @@
+package main
+
+// The pb stubs this file depends on (pb.Pipeline, pb.RegisterSubprocessEngineServer,
+// ...) are generated from proto/pipeline.proto and gitignored rather than
+// checked in. Run `make generate` (or `go generate ./...`) once before
+// building this package, and again whenever the .proto changes.
+//go:generate protoc --go_out=. --go-grpc_out=. proto/pipeline.proto
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/antongulenko/bitflow-process-agent/proto"
+)
+
+// ServeGrpc starts the gRPC mirror of the HTTP API on endpoint (e.g.
+// ":7071"). It shares the engine's pipeline registry and per-pipeline line
+// buffers with ServeHttp, so both transports observe identical state.
+func (engine *SubprocessEngine) ServeGrpc(endpoint string) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %v: %v", endpoint, err)
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(engine.unaryAuthInterceptor),
+		grpc.StreamInterceptor(engine.streamAuthInterceptor),
+	)
+	pb.RegisterSubprocessEngineServer(server, &grpcServer{engine: engine})
+	return server.Serve(listener)
+}
+
+type grpcServer struct {
+	pb.UnimplementedSubprocessEngineServer
+	engine *SubprocessEngine
+}
+
+func (s *grpcServer) lookupPipeline(id int32) (*RunningPipeline, error) {
+	pipe, exists := s.engine.getPipelineById(int(id))
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "pipeline does not exist: %v", id)
+	}
+	return pipe, nil
+}
+
+func (s *grpcServer) Ping(ctx context.Context, _ *emptypb.Empty) (*pb.PingResponse, error) {
+	return &pb.PingResponse{Message: "pong"}, nil
+}
+
+func (s *grpcServer) Info(ctx context.Context, _ *emptypb.Empty) (*pb.InfoResponse, error) {
+	return &pb.InfoResponse{NumPipelines: int32(s.engine.numPipelines())}, nil
+}
+
+func (s *grpcServer) Capabilities(ctx context.Context, _ *emptypb.Empty) (*pb.CapabilitiesResponse, error) {
+	return &pb.CapabilitiesResponse{MaxLogsUpload: int32(s.engine.capabilities.MaxLogsUpload)}, nil
+}
+
+func (s *grpcServer) ListPipelines(ctx context.Context, req *pb.ListPipelinesRequest) (*pb.ListPipelinesResponse, error) {
+	ids := s.engine.filteredPipelineIds(func(pipe *RunningPipeline) bool {
+		return !req.RunningOnly || pipe.Status() == StatusRunning
+	})
+	return &pb.ListPipelinesResponse{Ids: ids}, nil
+}
+
+func (s *grpcServer) SubmitPipeline(ctx context.Context, req *pb.SubmitPipelineRequest) (*pb.Pipeline, error) {
+	delay := DefaultNewPipelineDelay
+	if req.Delay != "" {
+		parsed, err := time.ParseDuration(req.Delay)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid delay: %v", err)
+		}
+		delay = parsed
+	}
+
+	var timeout time.Duration
+	if req.Timeout != "" {
+		parsed, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid timeout: %v", err)
+		}
+		timeout = parsed
+	}
+
+	pipe := s.engine.NewPipeline(req.Script, delay, req.Params, timeout, grpcIdentity(ctx), nil)
+	return pipe.toProto(), nil
+}
+
+func (s *grpcServer) GetPipeline(ctx context.Context, req *pb.PipelineRequest) (*pb.Pipeline, error) {
+	pipe, err := s.lookupPipeline(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOwnership(ctx, pipe); err != nil {
+		return nil, err
+	}
+	return pipe.toProto(), nil
+}
+
+func (s *grpcServer) KillPipeline(ctx context.Context, req *pb.PipelineRequest) (*pb.Pipeline, error) {
+	pipe, err := s.lookupPipeline(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOwnership(ctx, pipe); err != nil {
+		return nil, err
+	}
+	if err := pipe.Kill(); err != nil {
+		return nil, status.Errorf(codes.Internal, "error killing pipeline %v: %v", pipe.Id, err)
+	}
+	return pipe.toProto(), nil
+}
+
+// Extend resets a pipeline's kill deadline, mirroring POST
+// /pipeline/:id/extend. It is meant to be called repeatedly with
+// exponential backoff over a single long-lived connection, so CI-style
+// agents can keep a pipeline alive without polling HTTP.
+func (s *grpcServer) Extend(ctx context.Context, req *pb.ExtendRequest) (*pb.Pipeline, error) {
+	pipe, err := s.lookupPipeline(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOwnership(ctx, pipe); err != nil {
+		return nil, err
+	}
+	if !pipe.hasDeadline() {
+		return nil, status.Errorf(codes.FailedPrecondition, "pipeline %v was not started with a timeout", pipe.Id)
+	}
+
+	duration := DefaultExtendDuration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid duration: %v", err)
+		}
+		duration = parsed
+	}
+
+	if err := pipe.extendDeadline(duration); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	return pipe.toProto(), nil
+}
+
+// TailPipeline streams log lines starting at from_line until the pipeline
+// exits or the client cancels the call, same semantics as
+// serveStreamPipelineOutput on the HTTP side.
+func (s *grpcServer) TailPipeline(req *pb.TailPipelineRequest, stream pb.SubprocessEngine_TailPipelineServer) error {
+	pipe, err := s.lookupPipeline(req.Id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkOwnership(stream.Context(), pipe); err != nil {
+		return err
+	}
+
+	backlog, lines, unsubscribe := pipe.subscribe(int(req.FromLine))
+	defer unsubscribe()
+
+	send := func(line LogLine) error {
+		return stream.Send(&pb.LogLine{
+			Seq:           int32(line.Seq),
+			Stream:        line.Stream,
+			TimestampUnix: line.Time.Unix(),
+			Text:          line.Text,
+		})
+	}
+	for _, line := range backlog {
+		if err := send(line); err != nil {
+			return err
+		}
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if err := send(line); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcIdentityCtxKey/grpcScopesCtxKey carry the authenticated caller's
+// identity and scopes through the request context, mirroring the Gin
+// context keys used by requireScope/checkOwnership on the HTTP side.
+type grpcIdentityCtxKey struct{}
+type grpcScopesCtxKey struct{}
+
+// grpcRequiredScope maps a gRPC method to the HTTP scope that gates the
+// equivalent route, so the two transports enforce identical authorization.
+func grpcRequiredScope(fullMethod string) Scope {
+	switch fullMethod {
+	case "/bitflowprocessagent.SubprocessEngine/SubmitPipeline",
+		"/bitflowprocessagent.SubprocessEngine/Extend":
+		return ScopeSubmit
+	case "/bitflowprocessagent.SubprocessEngine/KillPipeline":
+		return ScopeKill
+	default:
+		return ScopeRead
+	}
+}
+
+// authenticateGrpc checks the "authorization: Bearer <token>" metadata entry
+// against engine.authenticator for the scope required by fullMethod. With no
+// authenticator configured it is a no-op, same as requireScope on the HTTP
+// side. On success it returns a context carrying the caller's identity and
+// scopes for downstream ownership checks.
+func (engine *SubprocessEngine) authenticateGrpc(ctx context.Context, fullMethod string) (context.Context, error) {
+	if engine.authenticator == nil {
+		return ctx, nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get("authorization")) == 0 {
+		return ctx, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	token := strings.TrimPrefix(md.Get("authorization")[0], "Bearer ")
+	identity, scopes, ok := engine.authenticator.Authenticate(token)
+	required := grpcRequiredScope(fullMethod)
+	if !ok || !(scopes[required] || scopes[ScopeAdmin]) {
+		return ctx, status.Errorf(codes.PermissionDenied, "token does not grant the required '%v' scope", required)
+	}
+
+	ctx = context.WithValue(ctx, grpcIdentityCtxKey{}, identity)
+	ctx = context.WithValue(ctx, grpcScopesCtxKey{}, scopes)
+	return ctx, nil
+}
+
+func (engine *SubprocessEngine) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := engine.authenticateGrpc(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (engine *SubprocessEngine) streamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := engine.authenticateGrpc(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedServerStream overrides Context() so the identity/scopes
+// stashed by authenticateGrpc reach the stream handler (TailPipeline).
+type authenticatedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(grpcIdentityCtxKey{}).(string)
+	return identity
+}
+
+func grpcIsAdmin(ctx context.Context) bool {
+	scopes, _ := ctx.Value(grpcScopesCtxKey{}).(map[Scope]bool)
+	return scopes[ScopeAdmin]
+}
+
+// checkOwnership mirrors the HTTP side's rule: a non-admin caller may only
+// act on pipelines it submitted itself.
+func (s *grpcServer) checkOwnership(ctx context.Context, pipe *RunningPipeline) error {
+	if s.engine.authenticator == nil || grpcIsAdmin(ctx) {
+		return nil
+	}
+	if pipe.Owner != "" && pipe.Owner != grpcIdentity(ctx) {
+		return status.Errorf(codes.PermissionDenied, "pipeline %v belongs to a different client", pipe.Id)
+	}
+	return nil
+}
@@ -14,23 +14,33 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const StreamFromQuery = "from"
+
 const (
 	DefaultNewPipelineDelay    = 200 * time.Millisecond
+	DefaultExtendDuration      = 5 * time.Minute
 	NewPipelineDelayQuery      = "delay"
 	NewPipelineParametersQuery = "params"
+	NewPipelineTimeoutQuery    = "timeout"
+	NewPipelineLabelsQuery     = "labels"
+	LabelSelectorQuery         = "label"
+	GroupByQuery               = "by"
 )
 
 func (engine *SubprocessEngine) ServeHttp(endpoint string) error {
 	g := golib.NewGinEngine()
-	g.GET("/ping", engine.servePing)
-	g.GET("/info", engine.serveInfo)
-	g.GET("/capabilities", engine.serveCapabilities)
-	g.GET("/pipelines", engine.servePipelines)
-	g.GET("/running", engine.serveRunningPipelines)
-	g.POST("/pipeline", engine.serveNewPipeline)
-	g.GET("/pipeline/:id", engine.serveGetPipeline)
-	g.GET("/pipeline/:id/out", engine.serveGetPipelineOutput)
-	g.DELETE("/pipeline/:id", engine.serveKillPipeline)
+	g.GET("/ping", engine.requireScope(ScopeRead), engine.servePing)
+	g.GET("/info", engine.requireScope(ScopeRead), engine.serveInfo)
+	g.GET("/capabilities", engine.requireScope(ScopeRead), engine.serveCapabilities)
+	g.GET("/pipelines", engine.requireScope(ScopeRead), engine.servePipelines)
+	g.GET("/pipelines/group", engine.requireScope(ScopeRead), engine.serveGroupPipelines)
+	g.GET("/running", engine.requireScope(ScopeRead), engine.serveRunningPipelines)
+	g.POST("/pipeline", engine.requireScope(ScopeSubmit), engine.serveNewPipeline)
+	g.GET("/pipeline/:id", engine.requireScope(ScopeRead), engine.serveGetPipeline)
+	g.GET("/pipeline/:id/out", engine.requireScope(ScopeRead), engine.serveGetPipelineOutput)
+	g.GET("/pipeline/:id/stream", engine.requireScope(ScopeRead), engine.serveStreamPipelineOutput)
+	g.POST("/pipeline/:id/extend", engine.requireScope(ScopeSubmit), engine.serveExtendPipeline)
+	g.DELETE("/pipeline/:id", engine.requireScope(ScopeKill), engine.serveKillPipeline)
 	return g.Run(endpoint)
 }
 
@@ -52,10 +62,16 @@ func (engine *SubprocessEngine) serveCapabilities(c *gin.Context) {
 }
 
 func (engine *SubprocessEngine) serveFilteredPipelineIds(c *gin.Context, accept func(*RunningPipeline) bool) {
+	selectors, err := parseLabelSelectorQuery(c)
+	if err != nil {
+		engine.replyString(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+
 	engine.pipelinesLock.Lock()
 	response := make([]int, 0, len(engine.pipelines))
 	for _, pipe := range engine.pipelines {
-		if accept(pipe) {
+		if accept(pipe) && matchesAllSelectors(pipe.Labels, selectors) {
 			response = append(response, pipe.Id)
 		}
 	}
@@ -72,13 +88,89 @@ func (engine *SubprocessEngine) servePipelines(c *gin.Context) {
 
 func (engine *SubprocessEngine) serveRunningPipelines(c *gin.Context) {
 	engine.serveFilteredPipelineIds(c, func(pipe *RunningPipeline) bool {
-		return pipe.Status == StatusRunning
+		return pipe.Status() == StatusRunning
 	})
 }
 
+// serveGroupPipelines groups every pipeline's ids by the value of a single
+// label key, e.g. "?by=owner" -> {"alice": [1, 2], "bob": [3]}. Pipelines
+// without that label are omitted.
+func (engine *SubprocessEngine) serveGroupPipelines(c *gin.Context) {
+	key := c.Query(GroupByQuery)
+	if key == "" {
+		engine.replyString(c, http.StatusBadRequest, "Provide the label key to group by as the '%v' query parameter.", GroupByQuery)
+		return
+	}
+
+	engine.pipelinesLock.Lock()
+	groups := make(map[string][]int)
+	for _, pipe := range engine.pipelines {
+		if value, ok := pipe.Labels[key]; ok {
+			groups[value] = append(groups[value], pipe.Id)
+		}
+	}
+	engine.pipelinesLock.Unlock()
+
+	for _, ids := range groups {
+		sort.Ints(ids)
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// parseLabelSelectorQuery parses the repeated "label" query parameters into
+// a list of LabelSelector terms, all of which must match (AND semantics).
+func parseLabelSelectorQuery(c *gin.Context) ([]LabelSelector, error) {
+	raw := c.QueryArray(LabelSelectorQuery)
+	selectors := make([]LabelSelector, 0, len(raw))
+	for _, term := range raw {
+		selector, err := parseLabelSelector(term)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func matchesAllSelectors(labels map[string]string, selectors []LabelSelector) bool {
+	for _, selector := range selectors {
+		if !selector.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// pipelineResponseBody is the JSON shape returned for a single pipeline. It
+// does not embed *RunningPipeline: RunningPipeline has its own MarshalJSON
+// (to take its status under a lock), and embedding a json.Marshaler would
+// have that promoted method take over marshaling of the whole body, silently
+// dropping Deadline/Remaining. Listing the fields explicitly instead, taken
+// through RunningPipeline's own locked accessors where relevant.
+type pipelineResponseBody struct {
+	Id        int               `json:"id"`
+	Script    string            `json:"script"`
+	Status    PipelineStatus    `json:"status"`
+	Owner     string            `json:"owner,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Deadline  *time.Time        `json:"deadline,omitempty"`
+	Remaining string            `json:"remaining,omitempty"`
+}
+
 func (engine *SubprocessEngine) pipelineResponse(pipe *RunningPipeline) interface{} {
-	// TODO maybe don't serve the entire internal struct?
-	return pipe
+	deadline, remaining := pipe.deadlineInfo()
+	body := pipelineResponseBody{
+		Id:     pipe.Id,
+		Script: pipe.Script,
+		Status: pipe.Status(),
+		Owner:  pipe.Owner,
+		Labels: pipe.Labels,
+	}
+	if deadline != nil {
+		body.Deadline = deadline
+		body.Remaining = remaining.String()
+	}
+	return body
 }
 
 func (engine *SubprocessEngine) serveNewPipeline(c *gin.Context) {
@@ -122,44 +214,153 @@ func (engine *SubprocessEngine) serveNewPipeline(c *gin.Context) {
 		extraParams = extraParamsSplit
 	}
 
-	pipeline, err := engine.NewPipeline(string(script), delay, extraParams)
-	if err != nil {
-		engine.replyString(c, http.StatusPreconditionFailed, "Error starting pipeline %v: %v", pipeline.Id, err.Error())
-	} else {
-		c.JSON(http.StatusCreated, engine.pipelineResponse(pipeline))
+	var timeout time.Duration
+	if timeoutStr := c.Query(NewPipelineTimeoutQuery); timeoutStr != "" {
+		parsedTimeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			engine.replyString(c, http.StatusBadRequest, "The parameter '%v' could not be parsed to a duration: %v. Example format: 5m",
+				NewPipelineTimeoutQuery, err)
+			return
+		}
+		timeout = parsedTimeout
+	}
+
+	var labels map[string]string
+	if labelsString := c.Query(NewPipelineLabelsQuery); labelsString != "" {
+		parsedLabels, err := parseLabels(labelsString)
+		if err != nil {
+			engine.replyString(c, http.StatusBadRequest, "The parameter '%v' could not be parsed: %v", NewPipelineLabelsQuery, err)
+			return
+		}
+		labels = parsedLabels
 	}
+
+	pipeline := engine.NewPipeline(string(script), delay, extraParams, timeout, requestIdentity(c), labels)
+	c.JSON(http.StatusCreated, engine.pipelineResponse(pipeline))
 }
 
 func (engine *SubprocessEngine) serveGetPipeline(c *gin.Context) {
 	pipe := engine.getPipeline(c)
-	if pipe != nil {
+	if pipe != nil && engine.checkOwnership(c, pipe) {
 		c.JSON(http.StatusOK, engine.pipelineResponse(pipe))
 	}
 }
 
 func (engine *SubprocessEngine) serveGetPipelineOutput(c *gin.Context) {
 	pipe := engine.getPipeline(c)
-	if pipe != nil {
-		out, err := pipe.GetOutput()
-		if err == nil {
-			c.Status(http.StatusOK)
-			c.Writer.Write(out)
-		} else {
-			engine.replyString(c, http.StatusInternalServerError, "Error obtaining output of pipeline %v", pipe.Id)
-		}
+	if pipe == nil || !engine.checkOwnership(c, pipe) {
+		return
+	}
+	out, err := pipe.GetOutput()
+	if err == nil {
+		c.Status(http.StatusOK)
+		c.Writer.Write(out)
+	} else {
+		engine.replyString(c, http.StatusInternalServerError, "Error obtaining output of pipeline %v", pipe.Id)
 	}
 }
 
-func (engine *SubprocessEngine) serveKillPipeline(c *gin.Context) {
+// serveStreamPipelineOutput delivers output lines as they are produced by
+// the subprocess, using HTTP chunked transfer with a flush after every line.
+// The "from" query parameter lets a client resume after a known line number
+// instead of re-reading everything from the start. The connection is closed
+// once the pipeline exits or the client disconnects.
+func (engine *SubprocessEngine) serveStreamPipelineOutput(c *gin.Context) {
 	pipe := engine.getPipeline(c)
-	if pipe != nil {
-		err := pipe.Kill()
+	if pipe == nil || !engine.checkOwnership(c, pipe) {
+		return
+	}
+
+	from := 0
+	if fromStr := c.Query(StreamFromQuery); fromStr != "" {
+		parsedFrom, err := strconv.Atoi(fromStr)
 		if err != nil {
-			engine.replyString(c, http.StatusInternalServerError, "Error killing pipeline %v: %v", pipe.Id, err)
-		} else {
-			c.JSON(http.StatusOK, pipe)
+			engine.replyString(c, http.StatusBadRequest, "The parameter '%v' could not be parsed to an int: %v", StreamFromQuery, err)
+			return
+		}
+		from = parsedFrom
+	}
+
+	backlog, lines, unsubscribe := pipe.subscribe(from)
+	defer unsubscribe()
+
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeLine := func(line LogLine) {
+		fmt.Fprintf(c.Writer, "%v\t%v\t%v\n", line.Seq, line.Stream, line.Text)
+		c.Writer.Flush()
+	}
+
+	for _, line := range backlog {
+		writeLine(line)
+	}
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			writeLine(line)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serveExtendPipeline resets a pipeline's kill deadline, so that long-running
+// but still-alive pipelines are not reaped by a stale timeout. The request
+// body may optionally carry {"duration": "5m"} to pick a duration other than
+// DefaultExtendDuration; a pipeline started without a timeout has nothing to
+// extend.
+func (engine *SubprocessEngine) serveExtendPipeline(c *gin.Context) {
+	pipe := engine.getPipeline(c)
+	if pipe == nil || !engine.checkOwnership(c, pipe) {
+		return
+	}
+	if !pipe.hasDeadline() {
+		engine.replyString(c, http.StatusPreconditionFailed, "Pipeline %v was not started with a timeout", pipe.Id)
+		return
+	}
+
+	duration := DefaultExtendDuration
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			engine.replyString(c, http.StatusBadRequest, "Failed to parse request body: %v", err)
+			return
+		}
+		if body.Duration != "" {
+			parsedDuration, err := time.ParseDuration(body.Duration)
+			if err != nil {
+				engine.replyString(c, http.StatusBadRequest, "The 'duration' field could not be parsed to a duration: %v. Example format: 5m", err)
+				return
+			}
+			duration = parsedDuration
 		}
 	}
+
+	if err := pipe.extendDeadline(duration); err != nil {
+		engine.replyString(c, http.StatusPreconditionFailed, "%v", err)
+		return
+	}
+	c.JSON(http.StatusOK, engine.pipelineResponse(pipe))
+}
+
+func (engine *SubprocessEngine) serveKillPipeline(c *gin.Context) {
+	pipe := engine.getPipeline(c)
+	if pipe == nil || !engine.checkOwnership(c, pipe) {
+		return
+	}
+	err := pipe.Kill()
+	if err != nil {
+		engine.replyString(c, http.StatusInternalServerError, "Error killing pipeline %v: %v", pipe.Id, err)
+	} else {
+		c.JSON(http.StatusOK, pipe)
+	}
 }
 
 func (engine *SubprocessEngine) getPipeline(c *gin.Context) *RunningPipeline {
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LabelSelector is a single term of the Kubernetes-style selector language
+// accepted by the "label" query parameter: equality (key=value), inequality
+// (key!=value) and set membership (key in (a,b)).
+type LabelSelector struct {
+	Key      string
+	Operator string // "=", "!=" or "in"
+	Values   []string
+}
+
+// parseLabelSelector parses a single selector term, e.g. "owner=alice",
+// "owner!=alice" or "owner in (alice,bob)".
+func parseLabelSelector(raw string) (LabelSelector, error) {
+	if idx := strings.Index(raw, "!="); idx >= 0 {
+		return LabelSelector{Key: strings.TrimSpace(raw[:idx]), Operator: "!=", Values: []string{strings.TrimSpace(raw[idx+2:])}}, nil
+	}
+	if idx := strings.Index(raw, " in "); idx >= 0 {
+		key := strings.TrimSpace(raw[:idx])
+		rest := strings.TrimSpace(raw[idx+4:])
+		rest = strings.TrimPrefix(rest, "(")
+		rest = strings.TrimSuffix(rest, ")")
+		values := strings.Split(rest, ",")
+		for i, v := range values {
+			values[i] = strings.TrimSpace(v)
+		}
+		return LabelSelector{Key: key, Operator: "in", Values: values}, nil
+	}
+	if idx := strings.Index(raw, "="); idx >= 0 {
+		return LabelSelector{Key: strings.TrimSpace(raw[:idx]), Operator: "=", Values: []string{strings.TrimSpace(raw[idx+1:])}}, nil
+	}
+	return LabelSelector{}, fmt.Errorf("invalid label selector %q: expected 'key=value', 'key!=value' or 'key in (a,b)'", raw)
+}
+
+// Matches reports whether labels satisfies the selector.
+func (sel LabelSelector) Matches(labels map[string]string) bool {
+	value, ok := labels[sel.Key]
+	switch sel.Operator {
+	case "=":
+		return ok && value == sel.Values[0]
+	case "!=":
+		return !ok || value != sel.Values[0]
+	case "in":
+		if !ok {
+			return false
+		}
+		for _, v := range sel.Values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// parseLabels parses the "k1=v1,k2=v2" syntax accepted by serveNewPipeline's
+// "labels" query parameter into a label map.
+func parseLabels(raw string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idx := strings.Index(pair, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid label %q: expected 'key=value'", pair)
+		}
+		labels[strings.TrimSpace(pair[:idx])] = strings.TrimSpace(pair[idx+1:])
+	}
+	return labels, nil
+}
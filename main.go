@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	httpEndpoint = flag.String("listen", ":7070", "Endpoint to serve the HTTP API on")
+	grpcEndpoint = flag.String("grpc-listen", ":7071", "Endpoint to serve the gRPC API on")
+	authConfig   = flag.String("auth-config", "", "Path to a YAML/JSON file mapping API tokens to scopes. If unset, the API requires no authentication.")
+)
+
+func main() {
+	flag.Parse()
+
+	engine := NewSubprocessEngine()
+	if *authConfig != "" {
+		tokens, err := LoadStaticTokens(*authConfig)
+		if err != nil {
+			log.Fatalln("Failed to load auth config:", err)
+		}
+		engine.authenticator = tokens
+	}
+
+	go func() {
+		if err := engine.ServeGrpc(*grpcEndpoint); err != nil {
+			log.Fatalln("Error serving gRPC API:", err)
+		}
+	}()
+
+	if err := engine.ServeHttp(*httpEndpoint); err != nil {
+		log.Fatalln("Error serving HTTP API:", err)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/antongulenko/bitflow-process-agent/proto"
+)
+
+type PipelineStatus string
+
+const (
+	StatusStarting PipelineStatus = "starting"
+	StatusRunning  PipelineStatus = "running"
+	StatusFinished PipelineStatus = "finished"
+	StatusFailed   PipelineStatus = "failed"
+	StatusKilled   PipelineStatus = "killed"
+	StatusTimedOut PipelineStatus = "timed_out"
+)
+
+// maxBufferedLines bounds the ring buffer of recent output lines kept per
+// pipeline for late-joining stream subscribers (see LogLine/subscribe).
+const maxBufferedLines = 10000
+
+// LogLine is a single line of captured subprocess output, numbered so that
+// streaming clients can resume from a known offset via the "from" query
+// parameter.
+type LogLine struct {
+	Seq    int       `json:"seq"`
+	Stream string    `json:"stream"` // "stdout" or "stderr"
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"`
+}
+
+// RunningPipeline represents a single Bitflow script executed as a
+// subprocess. Besides the final exit status it keeps a bounded ring buffer
+// of recent output lines plus a set of subscriber channels, so that both the
+// "/out" snapshot endpoint and the incremental "/stream" endpoint can be
+// served from the same captured data.
+type RunningPipeline struct {
+	Id     int               `json:"id"`
+	Script string            `json:"script"`
+	Owner  string            `json:"owner,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	engine  *SubprocessEngine
+	timeout time.Duration
+
+	// cmdLock guards cmd: it is assigned from the start-delay goroutine in
+	// run() and read concurrently by Kill() from HTTP/gRPC handlers.
+	cmdLock sync.Mutex
+	cmd     *exec.Cmd
+
+	// outputLock also guards status: both are touched by the scanning
+	// goroutines and read concurrently by HTTP/gRPC handlers, so they share
+	// one lock rather than risking a race between the two.
+	outputLock  sync.Mutex
+	status      PipelineStatus
+	lines       []LogLine
+	nextSeq     int
+	subscribers map[chan LogLine]struct{}
+
+	timerLock sync.Mutex
+	timer     *time.Timer
+	deadline  *time.Time
+}
+
+// start arms the delayed launch of the subprocess. Launching always happens
+// later, on the AfterFunc goroutine, so there is nothing for start itself to
+// fail on; any failure to exec the subprocess is reported through the
+// pipeline's status (StatusFailed) once run attempts it, not through a
+// synchronous return value.
+func (pipe *RunningPipeline) start(delay time.Duration, extraParams []string, timeout time.Duration) {
+	pipe.timeout = timeout
+	time.AfterFunc(delay, func() {
+		pipe.run(extraParams)
+	})
+}
+
+func (pipe *RunningPipeline) run(extraParams []string) {
+	cmd := exec.Command("bitflow-pipeline", extraParams...)
+	cmd.Stdin = strings.NewReader(pipe.Script)
+	pipe.setCmd(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		pipe.setStatus(StatusFailed)
+		return
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		pipe.setStatus(StatusFailed)
+		return
+	}
+
+	if err := cmd.Start(); err != nil {
+		pipe.setStatus(StatusFailed)
+		return
+	}
+	pipe.setStatus(StatusRunning)
+	if pipe.timeout > 0 {
+		pipe.setDeadline(pipe.timeout)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go pipe.scanOutput(stdout, "stdout", &wg)
+	go pipe.scanOutput(stderr, "stderr", &wg)
+	wg.Wait()
+
+	err = cmd.Wait()
+	pipe.stopTimer()
+	if status := pipe.Status(); status != StatusTimedOut && status != StatusKilled {
+		if err != nil {
+			pipe.setStatus(StatusFailed)
+		} else {
+			pipe.setStatus(StatusFinished)
+		}
+	}
+	pipe.closeSubscribers()
+}
+
+// setDeadline (re-)arms the pipeline's kill timer to fire after d, stopping
+// and draining any timer that was already running. Mirrors the
+// mutex-guarded *time.Timer pattern used for connection deadlines in gonet.
+func (pipe *RunningPipeline) setDeadline(d time.Duration) {
+	pipe.timerLock.Lock()
+	defer pipe.timerLock.Unlock()
+
+	if pipe.timer != nil && !pipe.timer.Stop() {
+		select {
+		case <-pipe.timer.C:
+		default:
+		}
+	}
+	deadline := time.Now().Add(d)
+	pipe.deadline = &deadline
+	pipe.timer = time.AfterFunc(d, pipe.onDeadline)
+}
+
+// stopTimer stops any armed kill timer and clears the deadline, so that a
+// pipeline which has already finished is no longer reported as having a
+// deadline and can no longer be re-armed via extend.
+func (pipe *RunningPipeline) stopTimer() {
+	pipe.timerLock.Lock()
+	defer pipe.timerLock.Unlock()
+	if pipe.timer != nil {
+		pipe.timer.Stop()
+	}
+	pipe.deadline = nil
+}
+
+func (pipe *RunningPipeline) onDeadline() {
+	if err := pipe.Kill(); err != nil {
+		log.Warnln("Error killing timed out pipeline", pipe.Id, ":", err)
+	}
+	pipe.setStatus(StatusTimedOut)
+}
+
+// extendDeadline re-arms the kill timer for d, rejecting the request once
+// the pipeline is no longer running: a finished pipeline has no process
+// left to kill, and re-arming it would let a stale timer overwrite its
+// final status with StatusTimedOut when it eventually fires.
+func (pipe *RunningPipeline) extendDeadline(d time.Duration) error {
+	if status := pipe.Status(); status != StatusRunning {
+		return fmt.Errorf("pipeline %v is not running (status: %v)", pipe.Id, status)
+	}
+	pipe.setDeadline(d)
+	return nil
+}
+
+func (pipe *RunningPipeline) hasDeadline() bool {
+	pipe.timerLock.Lock()
+	defer pipe.timerLock.Unlock()
+	return pipe.deadline != nil
+}
+
+// deadlineInfo reports the current deadline and the time remaining until it
+// fires, for inclusion in the pipeline's HTTP representation.
+func (pipe *RunningPipeline) deadlineInfo() (*time.Time, time.Duration) {
+	pipe.timerLock.Lock()
+	defer pipe.timerLock.Unlock()
+	if pipe.deadline == nil {
+		return nil, 0
+	}
+	remaining := time.Until(*pipe.deadline)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return pipe.deadline, remaining
+}
+
+// scanOutput line-buffers one of the subprocess' output streams, appending
+// each line to the ring buffer and fanning it out to subscribers. Reading is
+// capped at maxLogsUpload bytes to bound memory use of runaway subprocesses.
+func (pipe *RunningPipeline) scanOutput(r io.ReadCloser, stream string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer r.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxLogsUpload))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogsUpload)
+	for scanner.Scan() {
+		pipe.appendLine(LogLine{
+			Stream: stream,
+			Time:   time.Now(),
+			Text:   scanner.Text(),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warnln("Error reading", stream, "of pipeline", pipe.Id, ":", err)
+	}
+}
+
+func (pipe *RunningPipeline) appendLine(line LogLine) {
+	pipe.outputLock.Lock()
+	line.Seq = pipe.nextSeq
+	pipe.nextSeq++
+	pipe.lines = append(pipe.lines, line)
+	if len(pipe.lines) > maxBufferedLines {
+		pipe.lines = pipe.lines[len(pipe.lines)-maxBufferedLines:]
+	}
+	subscribers := make([]chan LogLine, 0, len(pipe.subscribers))
+	for sub := range pipe.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	pipe.outputLock.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub <- line:
+		default:
+			// Slow subscriber: drop the line rather than blocking the subprocess pump.
+		}
+	}
+}
+
+// subscribe registers a new stream subscriber and returns the lines already
+// buffered at or after from, plus a channel that receives every subsequent
+// line. The returned unsubscribe func must be called once the caller is done
+// reading. If the pipeline has already reached a terminal status, the
+// backlog is returned alongside an already-closed channel, since run() has
+// already called closeSubscribers and nothing will ever write to a fresh
+// subscriber channel at that point.
+func (pipe *RunningPipeline) subscribe(from int) ([]LogLine, chan LogLine, func()) {
+	pipe.outputLock.Lock()
+	defer pipe.outputLock.Unlock()
+
+	var backlog []LogLine
+	for _, line := range pipe.lines {
+		if line.Seq >= from {
+			backlog = append(backlog, line)
+		}
+	}
+
+	if isTerminalStatus(pipe.status) {
+		closed := make(chan LogLine)
+		close(closed)
+		return backlog, closed, func() {}
+	}
+
+	ch := make(chan LogLine, 64)
+	if pipe.subscribers == nil {
+		pipe.subscribers = make(map[chan LogLine]struct{})
+	}
+	pipe.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		pipe.outputLock.Lock()
+		delete(pipe.subscribers, ch)
+		pipe.outputLock.Unlock()
+	}
+	return backlog, ch, unsubscribe
+}
+
+func isTerminalStatus(status PipelineStatus) bool {
+	switch status {
+	case StatusFinished, StatusFailed, StatusKilled, StatusTimedOut:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pipe *RunningPipeline) closeSubscribers() {
+	pipe.outputLock.Lock()
+	defer pipe.outputLock.Unlock()
+	for sub := range pipe.subscribers {
+		close(sub)
+	}
+	pipe.subscribers = nil
+}
+
+func (pipe *RunningPipeline) setStatus(status PipelineStatus) {
+	pipe.outputLock.Lock()
+	pipe.status = status
+	pipe.outputLock.Unlock()
+}
+
+// Status returns the pipeline's current status. Use this instead of reading
+// a field directly: the status is written from the subprocess-watching
+// goroutine and read concurrently from HTTP/gRPC handlers.
+func (pipe *RunningPipeline) Status() PipelineStatus {
+	pipe.outputLock.Lock()
+	defer pipe.outputLock.Unlock()
+	return pipe.status
+}
+
+// MarshalJSON renders the pipeline's public JSON representation, taking the
+// status under outputLock rather than exposing it as a plain struct field.
+func (pipe *RunningPipeline) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Id     int               `json:"id"`
+		Script string            `json:"script"`
+		Status PipelineStatus    `json:"status"`
+		Owner  string            `json:"owner,omitempty"`
+		Labels map[string]string `json:"labels,omitempty"`
+	}{
+		Id:     pipe.Id,
+		Script: pipe.Script,
+		Status: pipe.Status(),
+		Owner:  pipe.Owner,
+		Labels: pipe.Labels,
+	})
+}
+
+// GetOutput returns the most recently captured output, stdout and stderr
+// interleaved in arrival order. It is a snapshot of the same bounded ring
+// buffer (maxBufferedLines) used to seed stream subscribers, so for a
+// pipeline that has produced more than maxBufferedLines lines this only
+// covers the tail of its output; use the "/stream" endpoint with "from=0" to
+// observe a long-running pipeline's output from the start instead.
+func (pipe *RunningPipeline) GetOutput() ([]byte, error) {
+	pipe.outputLock.Lock()
+	defer pipe.outputLock.Unlock()
+
+	var buf []byte
+	for _, line := range pipe.lines {
+		buf = append(buf, []byte(fmt.Sprintf("[%v] %v\n", line.Stream, line.Text))...)
+	}
+	return buf, nil
+}
+
+// toProto converts the pipeline to its gRPC representation, sharing the same
+// deadline/remaining computation as the HTTP pipelineResponse.
+func (pipe *RunningPipeline) toProto() *pb.Pipeline {
+	p := &pb.Pipeline{
+		Id:     int32(pipe.Id),
+		Script: pipe.Script,
+		Status: string(pipe.Status()),
+		Owner:  pipe.Owner,
+		Labels: pipe.Labels,
+	}
+	if deadline, remaining := pipe.deadlineInfo(); deadline != nil {
+		p.DeadlineUnix = deadline.Unix()
+		p.Remaining = remaining.String()
+	}
+	return p
+}
+
+func (pipe *RunningPipeline) setCmd(cmd *exec.Cmd) {
+	pipe.cmdLock.Lock()
+	pipe.cmd = cmd
+	pipe.cmdLock.Unlock()
+}
+
+func (pipe *RunningPipeline) getCmd() *exec.Cmd {
+	pipe.cmdLock.Lock()
+	defer pipe.cmdLock.Unlock()
+	return pipe.cmd
+}
+
+func (pipe *RunningPipeline) Kill() error {
+	cmd := pipe.getCmd()
+	if cmd == nil || cmd.Process == nil {
+		return fmt.Errorf("pipeline %v is not running", pipe.Id)
+	}
+	err := cmd.Process.Kill()
+	if err == nil {
+		pipe.setStatus(StatusKilled)
+	}
+	return err
+}